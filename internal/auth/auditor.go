@@ -0,0 +1,49 @@
+package auth
+
+import "time"
+
+// AuditEvent records a single authentication-related action for the
+// forensic trail exposed via GET /api/admin/audit.
+type AuditEvent struct {
+	Timestamp time.Time
+	Ident     string
+	Username  string
+	RemoteIP  string
+	UserAgent string
+	Event     string
+	Success   bool
+	Reason    string
+}
+
+// Auditor persists AuditEvents and makes them queryable by ident.
+type Auditor interface {
+	// Record stores a single AuditEvent.
+	Record(event AuditEvent) error
+
+	// ListEvents returns events for ident which happened at or after
+	// since, newest first, bounded by limit.
+	ListEvents(ident string, since time.Time, limit int) ([]AuditEvent, error)
+
+	// Prune removes events older than retention.
+	Prune(retention time.Duration) error
+}
+
+// StartAuditPruner runs Prune on a on the given interval until stop is
+// closed. Errors are swallowed by errHandler so that a transient
+// database hiccup does not bring down the pruning loop.
+func StartAuditPruner(auditor Auditor, interval, retention time.Duration, stop <-chan struct{}, errHandler func(error)) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := auditor.Prune(retention); err != nil && errHandler != nil {
+					errHandler(err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"errors"
+
+	"github.com/zekroTJA/vplan2019/internal/config"
+)
+
+// ChainProvider tries a list of Providers in order and returns the
+// first successful Authenticate result, falling through to the next
+// provider on failure. This allows operators to e.g. try LDAP first
+// and fall back to OIDC.
+type ChainProvider struct {
+	Providers []Provider
+}
+
+// NewChainProvider creates a ChainProvider wrapping the given
+// providers in the order they should be tried.
+func NewChainProvider(providers ...Provider) *ChainProvider {
+	return &ChainProvider{Providers: providers}
+}
+
+// Connect is a no-op, since the chained providers are expected to
+// already be connected individually.
+func (c *ChainProvider) Connect(config.Model) error { return nil }
+
+// Close closes all chained providers.
+func (c *ChainProvider) Close() {
+	for _, p := range c.Providers {
+		p.Close()
+	}
+}
+
+// GetConfigModel returns an empty config model, since a ChainProvider
+// has no configuration of its own.
+func (c *ChainProvider) GetConfigModel() config.Model {
+	return config.Model{}
+}
+
+// Authenticate tries each chained provider in order and returns the
+// first successful result. If all providers fail, the last error is
+// returned.
+func (c *ChainProvider) Authenticate(username, group, password string) (*Response, error) {
+	if len(c.Providers) == 0 {
+		return nil, errors.New("auth: chain provider has no providers configured")
+	}
+
+	var lastErr error
+	for _, p := range c.Providers {
+		resp, err := p.Authenticate(username, group, password)
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
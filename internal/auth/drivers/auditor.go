@@ -0,0 +1,110 @@
+package drivers
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/zekroTJA/vplan2019/internal/auth"
+	"github.com/zekroTJA/vplan2019/internal/database"
+	"github.com/zekroTJA/vplan2019/pkg/multierror"
+)
+
+// timeFormat matches the layout drivers.MySQL (internal/database/drivers)
+// parses its own TIMESTAMP columns with. The connection's DSN is built
+// without parseTime=true, so go-sql-driver/mysql returns TIMESTAMP
+// columns as []byte rather than time.Time; ts must be scanned into a
+// database.Timestamp and parsed manually, same as the rest of the
+// codebase does.
+const timeFormat = "2006-01-02 15:04:05"
+
+// MySQLAuditor is a MySQL-backed auth.Auditor, storing events in the
+// `apiaudit` table next to the existing apitoken/apilogintoken tables.
+type MySQLAuditor struct {
+	db *sql.DB
+
+	insertEvent     *sql.Stmt
+	selectByIdent   *sql.Stmt
+	deleteOlderThan *sql.Stmt
+}
+
+// NewMySQLAuditor creates a MySQLAuditor on top of an already
+// connected *sql.DB, creating the `apiaudit` table if it does not
+// exist yet and preparing all statements it needs.
+func NewMySQLAuditor(db *sql.DB) (*MySQLAuditor, error) {
+	a := &MySQLAuditor{db: db}
+
+	_, err := db.Exec("CREATE TABLE IF NOT EXISTS `apiaudit` (" +
+		"`id` int PRIMARY KEY AUTO_INCREMENT," +
+		"`ts` timestamp NOT NULL," +
+		"`ident` text NOT NULL," +
+		"`username` text NOT NULL," +
+		"`remote_ip` text NOT NULL," +
+		"`user_agent` text NOT NULL," +
+		"`event` text NOT NULL," +
+		"`success` bool NOT NULL," +
+		"`reason` text NOT NULL );")
+	if err != nil {
+		return nil, err
+	}
+
+	m := multierror.NewMultiError(nil)
+	a.insertEvent = a.prepareStatement(m,
+		"INSERT INTO apiaudit (ts, ident, username, remote_ip, user_agent, event, success, reason) "+
+			"VALUES (?, ?, ?, ?, ?, ?, ?, ?)")
+	a.selectByIdent = a.prepareStatement(m,
+		"SELECT ts, ident, username, remote_ip, user_agent, event, success, reason FROM apiaudit "+
+			"WHERE ident = ? AND ts >= ? ORDER BY ts DESC LIMIT ?")
+	a.deleteOlderThan = a.prepareStatement(m,
+		"DELETE FROM apiaudit WHERE ts < ?")
+
+	if err = m.Concat(); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+func (a *MySQLAuditor) prepareStatement(multiError *multierror.MultiError, query string) *sql.Stmt {
+	stmt, err := a.db.Prepare(query)
+	multiError.Append(err)
+	return stmt
+}
+
+// Record stores a single auth.AuditEvent.
+func (a *MySQLAuditor) Record(event auth.AuditEvent) error {
+	_, err := a.insertEvent.Exec(event.Timestamp, event.Ident, event.Username,
+		event.RemoteIP, event.UserAgent, event.Event, event.Success, event.Reason)
+	return err
+}
+
+// ListEvents returns events for ident which happened at or after
+// since, newest first, bounded by limit.
+func (a *MySQLAuditor) ListEvents(ident string, since time.Time, limit int) ([]auth.AuditEvent, error) {
+	rows, err := a.selectByIdent.Query(ident, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]auth.AuditEvent, 0)
+	for rows.Next() {
+		var e auth.AuditEvent
+		var ts database.Timestamp
+		if err = rows.Scan(&ts, &e.Ident, &e.Username, &e.RemoteIP,
+			&e.UserAgent, &e.Event, &e.Success, &e.Reason); err != nil {
+			return nil, err
+		}
+		if e.Timestamp, err = time.Parse(timeFormat, string(ts)); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+// Prune removes events older than retention.
+func (a *MySQLAuditor) Prune(retention time.Duration) error {
+	_, err := a.deleteOlderThan.Exec(time.Now().Add(-retention))
+	return err
+}
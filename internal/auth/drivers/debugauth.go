@@ -9,6 +9,10 @@ import (
 	"github.com/zekroTJA/vplan2019/internal/config"
 )
 
+func init() {
+	auth.Register("debug", func() auth.Provider { return new(DebugAuthProvider) })
+}
+
 // DebugAuthProvider is an auth provider, which
 // is only purposed to use in debugging and testing
 type DebugAuthProvider struct {
@@ -34,7 +38,7 @@ func (d *DebugAuthProvider) GetConfigModel() config.Model {
 }
 
 // Authenticate _
-func (d *DebugAuthProvider) Authenticate(username, password string) (*auth.Response, error) {
+func (d *DebugAuthProvider) Authenticate(username, group, password string) (*auth.Response, error) {
 	if pw, ok := d.creds[username]; ok && pw == password {
 		ident := fmt.Sprintf("%x", sha256.Sum256([]byte(username+password)))
 		return &auth.Response{
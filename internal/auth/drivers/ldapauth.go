@@ -0,0 +1,101 @@
+package drivers
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/zekroTJA/vplan2019/internal/auth"
+	"github.com/zekroTJA/vplan2019/internal/config"
+)
+
+func init() {
+	auth.Register("ldap", func() auth.Provider { return new(LDAPAuthProvider) })
+}
+
+// LDAPAuthProvider authenticates users against an LDAP/AD directory
+// using a bind-then-search strategy: the configured bind user looks
+// up the entry for the given username, and the found DN is then used
+// to bind once more with the passed password to verify it.
+type LDAPAuthProvider struct {
+	cfg config.Model
+
+	host       string
+	baseDN     string
+	bindDN     string
+	bindPasswd string
+	userFilter string
+}
+
+// Connect _
+func (d *LDAPAuthProvider) Connect(options config.Model) error {
+	d.cfg = options
+	d.host = options["host"]
+	d.baseDN = options["baseDn"]
+	d.bindDN = options["bindDn"]
+	d.bindPasswd = options["bindPassword"]
+	d.userFilter = options["userFilter"]
+	if d.userFilter == "" {
+		d.userFilter = "(uid=%s)"
+	}
+	return nil
+}
+
+// Close _
+func (d *LDAPAuthProvider) Close() {}
+
+// GetConfigModel _
+func (d *LDAPAuthProvider) GetConfigModel() config.Model {
+	return config.Model{
+		"host":         "ldap://localhost:389",
+		"baseDn":       "dc=example,dc=com",
+		"bindDn":       "cn=admin,dc=example,dc=com",
+		"bindPassword": "",
+		"userFilter":   "(uid=%s)",
+	}
+}
+
+// Authenticate binds as the configured service account, searches for
+// the entry matching username below baseDN and then re-binds as that
+// entry's DN with the passed password to verify it.
+func (d *LDAPAuthProvider) Authenticate(username, group, password string) (*auth.Response, error) {
+	// RFC 4513 §5.1.2: most LDAP servers treat a bind with a valid DN
+	// and an empty password as a successful "unauthenticated bind".
+	// Reject it here rather than relying on callers to pre-filter.
+	if password == "" {
+		return nil, errors.New("unauthorized")
+	}
+
+	conn, err := ldap.DialURL(d.host)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err = conn.Bind(d.bindDN, d.bindPasswd); err != nil {
+		return nil, err
+	}
+
+	searchReq := ldap.NewSearchRequest(
+		d.baseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 1, 0, false,
+		fmt.Sprintf(d.userFilter, ldap.EscapeFilter(username)),
+		[]string{"dn"}, nil,
+	)
+
+	res, err := conn.Search(searchReq)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Entries) != 1 {
+		return nil, errors.New("unauthorized")
+	}
+	userDN := res.Entries[0].DN
+
+	if err = conn.Bind(userDN, password); err != nil {
+		return nil, errors.New("unauthorized")
+	}
+
+	ident := fmt.Sprintf("%x", sha256.Sum256([]byte(userDN)))
+	return &auth.Response{Ident: ident}, nil
+}
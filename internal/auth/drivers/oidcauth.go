@@ -0,0 +1,86 @@
+package drivers
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/zekroTJA/vplan2019/internal/auth"
+	"github.com/zekroTJA/vplan2019/internal/config"
+	"golang.org/x/oauth2"
+)
+
+func init() {
+	auth.Register("oidc", func() auth.Provider { return new(OIDCAuthProvider) })
+}
+
+// OIDCAuthProvider authenticates users against an OIDC identity
+// provider using the resource owner password credentials grant,
+// which keeps the Authenticate(username, group, password) shape the
+// rest of the auth package relies on.
+type OIDCAuthProvider struct {
+	cfg config.Model
+
+	ctx      context.Context
+	provider *oidc.Provider
+	verifier *oidc.IDTokenVerifier
+	oauthCfg oauth2.Config
+}
+
+// Connect _
+func (d *OIDCAuthProvider) Connect(options config.Model) error {
+	d.cfg = options
+	d.ctx = context.Background()
+
+	provider, err := oidc.NewProvider(d.ctx, options["issuer"])
+	if err != nil {
+		return err
+	}
+	d.provider = provider
+	d.verifier = provider.Verifier(&oidc.Config{ClientID: options["clientId"]})
+	d.oauthCfg = oauth2.Config{
+		ClientID:     options["clientId"],
+		ClientSecret: options["clientSecret"],
+		Endpoint:     provider.Endpoint(),
+		Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
+	}
+
+	return nil
+}
+
+// Close _
+func (d *OIDCAuthProvider) Close() {}
+
+// GetConfigModel _
+func (d *OIDCAuthProvider) GetConfigModel() config.Model {
+	return config.Model{
+		"issuer":       "https://accounts.example.com",
+		"clientId":     "",
+		"clientSecret": "",
+	}
+}
+
+// Authenticate exchanges username/password for tokens via the
+// resource owner password grant and verifies the returned ID token
+// to resolve the remote identity.
+func (d *OIDCAuthProvider) Authenticate(username, group, password string) (*auth.Response, error) {
+	token, err := d.oauthCfg.PasswordCredentialsToken(d.ctx, username, password)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("unauthorized: no id_token in response")
+	}
+
+	idToken, err := d.verifier.Verify(d.ctx, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+
+	ident := fmt.Sprintf("%x", sha256.Sum256([]byte(idToken.Subject)))
+	return &auth.Response{Ident: ident}, nil
+}
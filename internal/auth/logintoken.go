@@ -0,0 +1,23 @@
+package auth
+
+import "time"
+
+// LoginTokenStore persists and consumes single-use, short-lived login
+// tokens minted by the SSO callback handlers. A token is deleted as
+// soon as it is consumed so that it can never be replayed, analogous
+// to how Matrix's m.login.token works on top of m.login.sso.
+type LoginTokenStore interface {
+	// CreateLoginToken mints a new login token for the passed ident,
+	// which expires after ttl.
+	CreateLoginToken(ident string, ttl time.Duration) (token string, expire time.Time, err error)
+
+	// ConsumeLoginToken resolves a login token to the ident it was
+	// issued for and deletes it in the same operation. If the token
+	// does not exist or already expired, ident is returned empty
+	// without an error.
+	ConsumeLoginToken(token string) (ident string, err error)
+
+	// GCExpiredLoginTokens removes all login tokens which expired
+	// without being consumed.
+	GCExpiredLoginTokens() error
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/zekroTJA/vplan2019/internal/config"
+)
+
+// Provider is implemented by pluggable password authentication
+// drivers (see internal/auth/drivers), which resolve a
+// username/group/password triple to a Response.
+type Provider interface {
+	// Connect initializes the provider with its own sub-map of the
+	// application config.
+	Connect(options config.Model) error
+
+	// Close releases any resources held by the provider.
+	Close()
+
+	// GetConfigModel returns a map with preset config keys and
+	// values used to generate a default config section.
+	GetConfigModel() config.Model
+
+	// Authenticate validates username/group/password against the
+	// provider's backend and, on success, resolves it to a Response.
+	Authenticate(username, group, password string) (*Response, error)
+}
+
+// Factory creates a new, unconnected Provider instance.
+type Factory func() Provider
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// Register adds a Provider factory under the given name to the
+// registry, so that it can be looked up and instantiated via
+// NewProvider. Register is expected to be called from a driver
+// package's init function.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = factory
+}
+
+// NewProvider looks up the factory registered under name, creates a
+// new Provider instance and connects it with the passed options.
+func NewProvider(name string, options config.Model) (Provider, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("auth: no provider registered as %q", name)
+	}
+
+	provider := factory()
+	if err := provider.Connect(options); err != nil {
+		return nil, err
+	}
+	return provider, nil
+}
@@ -0,0 +1,130 @@
+// Package config contains the configuration model used to bootstrap
+// the webserver as well as the pluggable database and auth drivers.
+package config
+
+import "time"
+
+// Model is a generic key-value configuration block handed to
+// pluggable drivers (database and auth) so that each driver can read
+// its own options without the rest of the config package needing to
+// know about driver-specific fields.
+type Model map[string]string
+
+// Config is the root configuration object loaded from the
+// application config file.
+type Config struct {
+	Auth      Auth
+	Sessions  Sessions
+	RateLimit RateLimit
+	Audit     Audit
+}
+
+// Audit configures the admin-facing authentication audit trail.
+type Audit struct {
+	// Admins lists the idents allowed to query GET /api/admin/audit.
+	Admins []string
+
+	// Retention is the max age of an audit event before it is
+	// removed by the background pruner.
+	Retention time.Duration
+
+	// PruneInterval is how often the background pruner runs.
+	PruneInterval time.Duration
+}
+
+// Auth contains configuration concerning the selection and setup of
+// auth.Provider implementations.
+type Auth struct {
+	// Provider is the name an auth.Provider was registered with via
+	// auth.Register, selecting which driver is used to authenticate
+	// password logins.
+	Provider string
+	Options  Model
+
+	// Chain lists provider names to try in order, wrapping them in
+	// an auth.ChainProvider. When set, it takes precedence over
+	// Provider.
+	Chain []string
+}
+
+// Sessions contains configuration for session and token based
+// authentication.
+type Sessions struct {
+	// RememberMaxAge is the max age in seconds applied to a session
+	// cookie when the client requests to be remembered across
+	// browser restarts.
+	RememberMaxAge int
+
+	// SSOProviders maps a provider name, as used in the
+	// /api/authenticate/sso/:provider routes, to its OAuth2/OIDC
+	// configuration.
+	SSOProviders map[string]SSOProvider
+}
+
+// RateLimit configures the per-route token buckets used by the
+// webserver's limiter as well as the trusted-proxy list used to
+// resolve a client's real IP behind X-Forwarded-For.
+type RateLimit struct {
+	// Routes maps a route name, as passed to limiter.Check, to its
+	// bucket configuration. A route without an entry falls back to
+	// Default.
+	Routes  map[string]RateLimitBucket
+	Default RateLimitBucket
+
+	// TrustedProxies lists CIDRs of reverse proxies which are
+	// trusted to set X-Forwarded-For. Requests from any other
+	// remote address use RemoteAddr as-is.
+	TrustedProxies []string
+
+	// MaxTrackedKeys bounds how many distinct route+key token
+	// buckets are kept in memory at once. Once exceeded, the least
+	// recently used bucket is evicted to make room for a new one.
+	MaxTrackedKeys int
+
+	// Authenticate configures the stricter bucket applied to
+	// POST /api/authenticate/:USERNAME, plus the exponential
+	// backoff applied after repeated failed passwords for the same
+	// username.
+	Authenticate AuthenticateRateLimit
+}
+
+// RateLimitBucket configures a token-bucket: Burst tokens are
+// available up-front and refill at RefillPerSec tokens per second.
+type RateLimitBucket struct {
+	Burst        int
+	RefillPerSec float64
+}
+
+// AuthenticateRateLimit extends RateLimitBucket with credential
+// stuffing mitigations tracked per username.
+type AuthenticateRateLimit struct {
+	RateLimitBucket
+
+	// MaxFailures is the number of consecutive failed passwords for
+	// a username that are tolerated; the exponential backoff kicks in
+	// with the next failure.
+	MaxFailures int
+
+	// BackoffBase is the initial backoff duration applied once
+	// MaxFailures is exceeded, doubling with each further failure
+	// up to BackoffMax.
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+
+	// TrackedUsernames bounds the size of the in-memory LRU used to
+	// track failures per username.
+	TrackedUsernames int
+}
+
+// SSOProvider contains the OAuth2/OIDC configuration needed to
+// redirect a client to an external identity provider and to exchange
+// the returned authorization code for an identity afterwards.
+type SSOProvider struct {
+	ClientID     string
+	ClientSecret string
+	AuthURL      string
+	TokenURL     string
+	UserInfoURL  string
+	RedirectURL  string
+	Scopes       []string
+}
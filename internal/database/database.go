@@ -0,0 +1,74 @@
+// Package database defines the storage-agnostic data model and the
+// Driver interface implemented by concrete storage backends (see
+// internal/database/drivers).
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// Timestamp is a raw database timestamp string, parsed by drivers
+// using their own time format.
+type Timestamp string
+
+// VPlan is a single substitution plan for a given date.
+type VPlan struct {
+	ID       int
+	DateEdit time.Time
+	DateFor  time.Time
+	Block    string
+	Header   string
+	Footer   string
+	Entries  []*VPlanEntry
+}
+
+// VPlanEntry is one row belonging to a VPlan.
+type VPlanEntry struct {
+	ID         int
+	VPlanID    int
+	Class      string
+	Time       string
+	Messures   string
+	Resposible string
+}
+
+// Driver is implemented by pluggable storage backends.
+type Driver interface {
+	// Connect opens the backend's connection pool depending on the
+	// passed options.
+	Connect(options map[string]string) error
+
+	// Close releases any resources held by the backend.
+	Close()
+
+	// Setup creates tables/schemas if they do not exist yet.
+	Setup() error
+
+	// GetConfigModel returns a map with preset config keys and
+	// values used to generate a default config section.
+	GetConfigModel() map[string]string
+
+	// GetSessionStoreDriver returns a new instance of the session
+	// store driver, which should be used for saving encrypted
+	// session data.
+	GetSessionStoreDriver(maxAge int, secrets ...[]byte) (sessions.Store, error)
+
+	// Ping verifies that the backend is reachable within ctx's
+	// deadline.
+	Ping(ctx context.Context) error
+
+	// HealthCheck exercises the backend with a throwaway write and
+	// delete round-trip and returns how long it took, for use by
+	// readiness/liveness probes.
+	HealthCheck(ctx context.Context) (time.Duration, error)
+
+	GetAPIToken(token string) (string, time.Time, error)
+	GetUserAPIToken(ident string) (string, time.Time, error)
+	SetUserAPIToken(ident, token string, expire time.Time) error
+	DeleteUserAPIToken(ident string) error
+
+	GetVPlans(class string, timestamp time.Time) ([]*VPlan, error)
+}
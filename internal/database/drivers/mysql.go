@@ -4,8 +4,12 @@
 package drivers
 
 import (
+	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/sessions"
@@ -16,6 +20,10 @@ import (
 
 const (
 	timeFormat = "2006-01-02 15:04:05"
+
+	// defaultPingTimeout is used when the "pingTimeout" config key is
+	// unset or fails to parse.
+	defaultPingTimeout = 5 * time.Second
 )
 
 // MySQL contains database functions
@@ -25,6 +33,10 @@ type MySQL struct {
 	dsn   string
 	db    *sql.DB
 	stmts *prepStatements
+
+	// allStmts collects every *sql.Stmt handed out by
+	// prepareStatement so that Close can close them all.
+	allStmts []*sql.Stmt
 }
 
 type prepStatements struct {
@@ -37,10 +49,16 @@ type prepStatements struct {
 	selectVPlans              *sql.Stmt
 	selectVPlanEntries        *sql.Stmt
 	selectVPlanEntriesByClass *sql.Stmt
+
+	insertLoginToken        *sql.Stmt
+	selectLoginToken        *sql.Stmt
+	deleteLoginToken        *sql.Stmt
+	deleteExpiredLoginToken *sql.Stmt
 }
 
-// Connect opens a MySql3 database file or creates
-// it if it does not exist depending on the passed options
+// Connect opens a connection pool to a MySQL database depending on
+// the passed options, verifies it is reachable via Ping and prepares
+// all statements used by the driver.
 func (s *MySQL) Connect(options map[string]string) error {
 	var err error
 
@@ -49,14 +67,56 @@ func (s *MySQL) Connect(options map[string]string) error {
 		options["user"], options["password"], options["host"], options["database"])
 
 	s.db, err = sql.Open("mysql", s.dsn)
-	err = s.setupPrepStatements()
+	if err != nil {
+		return err
+	}
 
-	return err
+	s.db.SetMaxOpenConns(atoiOrDefault(options["maxOpenConns"], 0))
+	s.db.SetMaxIdleConns(atoiOrDefault(options["maxIdleConns"], 2))
+	s.db.SetConnMaxLifetime(durationOrDefault(options["connMaxLifetime"], 0))
+
+	ctx, cancel := context.WithTimeout(context.Background(), durationOrDefault(options["pingTimeout"], defaultPingTimeout))
+	defer cancel()
+	if err = s.Ping(ctx); err != nil {
+		return err
+	}
+
+	return s.setupPrepStatements()
+}
+
+// Ping verifies that the database is reachable within ctx's deadline.
+func (s *MySQL) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func atoiOrDefault(raw string, def int) int {
+	if raw == "" {
+		return def
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+func durationOrDefault(raw string, def time.Duration) time.Duration {
+	if raw == "" {
+		return def
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return def
+	}
+	return d
 }
 
 func (s *MySQL) prepareStatement(multiError *multierror.MultiError, query string) *sql.Stmt {
 	stmt, err := s.db.Prepare(query)
 	multiError.Append(err)
+	if stmt != nil {
+		s.allStmts = append(s.allStmts, stmt)
+	}
 	return stmt
 }
 
@@ -78,11 +138,23 @@ func (s *MySQL) setupPrepStatements() error {
 	s.stmts.selectVPlanEntriesByClass = s.prepareStatement(m,
 		"SELECT id, vplan_id, class, time, messures, responsible FROM vplan_details WHERE vplan_id = ? AND class = ? AND deleted = 0")
 
+	s.stmts.insertLoginToken = s.prepareStatement(m,
+		"INSERT INTO apilogintoken (ident, token, expire) VALUES (?, ?, ?)")
+	s.stmts.selectLoginToken = s.prepareStatement(m,
+		"SELECT ident, expire FROM apilogintoken WHERE token = ?")
+	s.stmts.deleteLoginToken = s.prepareStatement(m,
+		"DELETE FROM apilogintoken WHERE token = ?")
+	s.stmts.deleteExpiredLoginToken = s.prepareStatement(m,
+		"DELETE FROM apilogintoken WHERE expire < ?")
+
 	return m.Concat()
 }
 
 // Close closes the MySql3 database file
 func (s *MySQL) Close() {
+	for _, stmt := range s.allStmts {
+		stmt.Close()
+	}
 	s.db.Close()
 }
 
@@ -97,6 +169,22 @@ func (s *MySQL) Setup() error {
 		return err
 	}
 
+	_, err = s.db.Exec("CREATE TABLE IF NOT EXISTS `apilogintoken` (" +
+		"`id` int PRIMARY KEY AUTO_INCREMENT," +
+		"`ident` text NOT NULL," +
+		"`token` text NOT NULL," +
+		"`expire` timestamp NOT NULL );")
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec("CREATE TABLE IF NOT EXISTS `health` (" +
+		"`id` int PRIMARY KEY AUTO_INCREMENT," +
+		"`probe` text NOT NULL );")
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -166,14 +254,107 @@ func (s *MySQL) DeleteUserAPIToken(ident string) error {
 	return err
 }
 
+// CreateLoginToken mints a single-use login token for ident, which
+// expires after ttl, and stores it in the apilogintoken table.
+func (s *MySQL) CreateLoginToken(ident string, ttl time.Duration) (string, time.Time, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", time.Time{}, err
+	}
+	token := hex.EncodeToString(raw)
+	expire := time.Now().Add(ttl)
+
+	_, err := s.stmts.insertLoginToken.Exec(ident, token, expire)
+	return token, expire, err
+}
+
+// ConsumeLoginToken resolves token to the ident it was issued for and
+// deletes it so that it cannot be used again. If the token does not
+// exist or already expired, ident is returned empty without an error.
+func (s *MySQL) ConsumeLoginToken(token string) (string, error) {
+	var ident string
+	var expire database.Timestamp
+
+	row := s.stmts.selectLoginToken.QueryRow(token)
+	err := row.Scan(&ident, &expire)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = nil
+		}
+		return "", err
+	}
+
+	res, err := s.stmts.deleteLoginToken.Exec(token)
+	if err != nil {
+		return "", err
+	}
+
+	// If the DELETE did not affect a row, another request already
+	// consumed (and deleted) this token concurrently between our
+	// SELECT and DELETE above; treat that as a miss rather than
+	// returning the ident a second time.
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+	if affected != 1 {
+		return "", nil
+	}
+
+	tExpire, err := time.Parse(timeFormat, string(expire))
+	if err != nil {
+		return "", err
+	}
+	if time.Now().After(tExpire) {
+		return "", nil
+	}
+
+	return ident, nil
+}
+
+// GCExpiredLoginTokens removes all login tokens which expired without
+// being consumed.
+func (s *MySQL) GCExpiredLoginTokens() error {
+	_, err := s.stmts.deleteExpiredLoginToken.Exec(time.Now())
+	return err
+}
+
+// HealthCheck exercises the storage by inserting and immediately
+// deleting a throwaway row on the `health` table, returning the time
+// this round-trip took. This is used by the webserver's /api/health
+// route to back real readiness/liveness probes.
+func (s *MySQL) HealthCheck(ctx context.Context) (time.Duration, error) {
+	start := time.Now()
+
+	res, err := s.db.ExecContext(ctx, "INSERT INTO health (probe) VALUES (?)", start.String())
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err = s.db.ExecContext(ctx, "DELETE FROM health WHERE id = ?", id); err != nil {
+		return 0, err
+	}
+
+	return time.Since(start), nil
+}
+
 // GetConfigModel returns a map with preset config
 // keys and values
 func (s *MySQL) GetConfigModel() map[string]string {
 	return map[string]string{
-		"host":     "localhost",
-		"user":     "vplan2",
-		"password": "",
-		"database": "vplan2",
+		"host":            "localhost",
+		"user":            "vplan2",
+		"password":        "",
+		"database":        "vplan2",
+		"maxOpenConns":    "0",
+		"maxIdleConns":    "2",
+		"connMaxLifetime": "1h",
+		"pingTimeout":     "5s",
 	}
 }
 
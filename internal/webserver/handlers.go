@@ -2,6 +2,7 @@ package webserver
 
 import (
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -17,7 +18,13 @@ import (
 // authRequestData contains request data for
 // POST /api/authenticate/:USERNAME
 type authRequestData struct {
+	// Type selects the login method to use. When empty or "password",
+	// Password is validated against the configured auth provider. When
+	// "token", Token is consumed as a single-use login token minted by
+	// the SSO callback flow.
+	Type     string `json:"type"`
 	Password string `json:"password"`
+	Token    string `json:"token"`
 	Group    string `json:"group"`
 	Session  int    `json:"session"`
 }
@@ -43,10 +50,6 @@ type authTokenResposeData struct {
 
 // POST /api/authenticate/:USERNAME
 func (s *Server) handlerAPIAuthenticate(w http.ResponseWriter, r *http.Request) {
-	if !s.limiter.Check("authenticate", w, r) {
-		return
-	}
-
 	urlParams := mux.Vars(r)
 	uname, ok := urlParams["username"]
 	if !ok {
@@ -54,22 +57,40 @@ func (s *Server) handlerAPIAuthenticate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if !s.limiter.CheckAuthenticate(uname, w, r) {
+		s.handlerAPIRateLimitError(w, r)
+		return
+	}
+
 	reqData := new(authRequestData)
 	if err := s.parseJSONBody(r.Body, reqData); err != nil {
 		jsonResponse(w, http.StatusBadRequest, apiError(http.StatusBadRequest, err.Error()))
 		return
 	}
 
-	passwd := reqData.Password
-	if passwd == "" {
-		jsonResponse(w, http.StatusBadRequest, apiError(http.StatusBadRequest, ""))
-		return
-	}
+	var authData *auth.Response
+	var err error
+	switch reqData.Type {
+	case "token":
+		authData, err = s.authenticateByLoginToken(reqData.Token)
+		if err != nil {
+			s.auditEvent(r, "", uname, "login", false, err.Error())
+			jsonResponse(w, http.StatusUnauthorized, apiError(http.StatusUnauthorized, ""))
+			return
+		}
+	default:
+		if reqData.Password == "" {
+			jsonResponse(w, http.StatusBadRequest, apiError(http.StatusBadRequest, ""))
+			return
+		}
 
-	authData, err := s.authProvider.Authenticate(uname, reqData.Group, passwd)
-	if err != nil {
-		jsonResponse(w, http.StatusUnauthorized, apiError(http.StatusUnauthorized, ""))
-		return
+		authData, err = s.authProvider.Authenticate(uname, reqData.Group, reqData.Password)
+		s.limiter.RecordAuthResult(uname, err == nil)
+		if err != nil {
+			s.auditEvent(r, "", uname, "login", false, err.Error())
+			jsonResponse(w, http.StatusUnauthorized, apiError(http.StatusUnauthorized, ""))
+			return
+		}
 	}
 
 	// Just to ensure we do not run into an runtime error
@@ -78,6 +99,8 @@ func (s *Server) handlerAPIAuthenticate(w http.ResponseWriter, r *http.Request)
 		authData = new(auth.Response)
 	}
 
+	s.auditEvent(r, authData.Ident, uname, "login", true, "")
+
 	respData := &authResponseData{
 		Ident: authData.Ident,
 		Ctx:   authData.Ctx,
@@ -100,6 +123,7 @@ func (s *Server) handlerAPIAuthenticate(w http.ResponseWriter, r *http.Request)
 		if err != nil {
 			jsonResponse(w, http.StatusInternalServerError, apiError(http.StatusInternalServerError, err.Error()))
 		} else {
+			s.auditEvent(r, authData.Ident, uname, "token-issue", true, "")
 			jsonResponse(w, http.StatusOK, authTokenResposeData{
 				Token:            token,
 				Expire:           expire,
@@ -112,19 +136,137 @@ func (s *Server) handlerAPIAuthenticate(w http.ResponseWriter, r *http.Request)
 	jsonResponse(w, http.StatusOK, respData)
 }
 
+// logoutResponseData reports exactly which credentials a logout or
+// sessions-revoke call tore down, so that callers never have to guess
+// the scope of what "revoked" actually meant.
+type logoutResponseData struct {
+	Revoked []string `json:"revoked"`
+}
+
 // POST /api/logout
+//
+// Revokes the caller's current credential: the bearer API token when
+// the request authenticated via Authorization header, or the
+// server-side session row tied to the request's own cookie when it
+// authenticated via cookie. Passing ?bothCredentials=true additionally
+// revokes whichever of the two was *not* used to authenticate this
+// request.
+//
+// This is scoped to ident's API token and to *this request's own*
+// cookie session. It cannot reach cookie sessions belonging to other
+// devices/browsers: the session store is keyed by session ID, not
+// ident, and gorilla/sessions' Store interface has no ident-indexed
+// lookup to enumerate them. The response's "revoked" field lists
+// exactly what was torn down so callers don't mistake this for a
+// sign-out of every device.
 func (s *Server) handlerAPILogout(w http.ResponseWriter, r *http.Request) {
-	if !s.limiter.Check("logout", w, r) {
+	if !s.limiter.Check("logout", s.resolveRateLimitIdent(r), w, r) {
+		s.handlerAPIRateLimitError(w, r)
+		return
+	}
+
+	ident := s.reqAuth.Check(w, r)
+	if ident == "" {
 		return
 	}
 
-	w.Header().Set("Set-Cookie", auth.MainSessionName+"=deleted; path=/; expires=Thu, 01 Jan 1970 00:00:00 GMT")
-	jsonResponse(w, http.StatusOK, nil)
+	bothCredentials := r.URL.Query().Get("bothCredentials") == "true"
+	revoked, err := s.revokeIdent(ident, bothCredentials, w, r)
+	if err != nil {
+		s.handlerAPIInternalError(w, r, err)
+		return
+	}
+
+	s.auditEvent(r, ident, "", "logout", true, "")
+	jsonResponse(w, http.StatusOK, logoutResponseData{Revoked: revoked})
+}
+
+// revokeIdent revokes ident's bearer API token, the server-side
+// session tied to r's own cookie, or both, depending on how r
+// authenticated and whether bothCredentials is set, and returns which
+// of "token"/"cookie" it actually revoked. It cannot reach cookie
+// sessions belonging to other devices; see handlerAPILogout.
+func (s *Server) revokeIdent(ident string, bothCredentials bool, w http.ResponseWriter, r *http.Request) ([]string, error) {
+	viaBearer := r.Header.Get("Authorization") != ""
+
+	var revoked []string
+
+	if bothCredentials || viaBearer {
+		if err := s.db.DeleteUserAPIToken(ident); err != nil {
+			return revoked, err
+		}
+		if err := s.tokenManager.Invalidate(ident); err != nil {
+			return revoked, err
+		}
+		revoked = append(revoked, "token")
+	}
+
+	if bothCredentials || !viaBearer {
+		session, err := s.store.Get(r, auth.MainSessionName)
+		if err != nil {
+			return revoked, err
+		}
+		// Setting MaxAge < 0 forces mysqlstore to delete the
+		// session row on Save instead of merely clobbering the
+		// client-side cookie.
+		session.Options.MaxAge = -1
+		if err := session.Save(r, w); err != nil {
+			return revoked, err
+		}
+		revoked = append(revoked, "cookie")
+	}
+
+	return revoked, nil
+}
+
+// POST /api/sessions/revoke/:ident
+//
+// Admin endpoint which revokes ident's bearer API token only, for
+// operators that need to force a sign-out without the affected user's
+// cooperation. It does not touch ident's cookie-based sessions on any
+// device, for the same reason handlerAPILogout can't reach other
+// devices' cookie sessions: the session store has no ident-indexed
+// lookup to find them. The response's "revoked" field is always
+// exactly ["token"], so operators don't mistake this for a full
+// sign-out everywhere.
+func (s *Server) handlerAPISessionsRevoke(w http.ResponseWriter, r *http.Request) {
+	if !s.limiter.Check("sessionsRevoke", s.resolveRateLimitIdent(r), w, r) {
+		s.handlerAPIRateLimitError(w, r)
+		return
+	}
+
+	callerIdent := s.reqAuth.Check(w, r)
+	if callerIdent == "" {
+		return
+	}
+	if !s.isAdmin(callerIdent) {
+		s.handlerAPIUnauthorizedError(w, r)
+		return
+	}
+
+	targetIdent, ok := mux.Vars(r)["ident"]
+	if !ok || targetIdent == "" {
+		jsonResponse(w, http.StatusBadRequest, apiError(http.StatusBadRequest, ""))
+		return
+	}
+
+	if err := s.db.DeleteUserAPIToken(targetIdent); err != nil {
+		s.handlerAPIInternalError(w, r, err)
+		return
+	}
+	if err := s.tokenManager.Invalidate(targetIdent); err != nil {
+		s.handlerAPIInternalError(w, r, err)
+		return
+	}
+
+	s.auditEvent(r, targetIdent, "", "session-revoke", true, "by="+callerIdent)
+	jsonResponse(w, http.StatusOK, logoutResponseData{Revoked: []string{"token"}})
 }
 
 // GET /api/vplan
 func (s *Server) handlerAPIGetVPlan(w http.ResponseWriter, r *http.Request) {
-	if !s.limiter.Check("getVPlan", w, r) {
+	if !s.limiter.Check("getVPlan", s.resolveRateLimitIdent(r), w, r) {
+		s.handlerAPIRateLimitError(w, r)
 		return
 	}
 
@@ -166,7 +308,8 @@ func (s *Server) handlerAPIGetVPlan(w http.ResponseWriter, r *http.Request) {
 // POST /api/test
 // Just for testing purposes
 func (s *Server) handlerAPITest(w http.ResponseWriter, r *http.Request) {
-	if !s.limiter.Check("test", w, r) {
+	if !s.limiter.Check("test", s.resolveRateLimitIdent(r), w, r) {
+		s.handlerAPIRateLimitError(w, r)
 		return
 	}
 
@@ -178,6 +321,38 @@ func (s *Server) handlerAPITest(w http.ResponseWriter, r *http.Request) {
 	logger.Debug("auth test: %s", ident)
 }
 
+// resolveRateLimitIdent attempts to resolve a verified ident for r,
+// for use as the rate-limiter key, without writing a response: a
+// bearer token is looked up in the API token store, a cookie is
+// resolved via the session store, which validates its signature
+// before returning an existing session. Either way, an unverifiable
+// credential resolves to "", so the caller falls back to per-IP
+// limiting instead of handing the request a fresh bucket for whatever
+// garbage header/cookie value it happened to send.
+func (s *Server) resolveRateLimitIdent(r *http.Request) string {
+	if bearer := r.Header.Get("Authorization"); bearer != "" {
+		token := strings.TrimPrefix(bearer, "Bearer ")
+		ident, expire, err := s.db.GetAPIToken(token)
+		if err != nil || ident == "" || time.Now().After(expire) {
+			return ""
+		}
+		return ident
+	}
+
+	cookie, err := r.Cookie(auth.MainSessionName)
+	if err != nil || cookie.Value == "" {
+		return ""
+	}
+
+	session, err := s.store.Get(r, auth.MainSessionName)
+	if err != nil || session.IsNew {
+		return ""
+	}
+
+	ident, _ := session.Values["ident"].(string)
+	return ident
+}
+
 ////////////////////
 // ERROR HANDLERS //
 ////////////////////
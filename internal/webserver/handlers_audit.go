@@ -0,0 +1,96 @@
+package webserver
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/zekroTJA/vplan2019/internal/auth"
+)
+
+const defaultAuditListLimit = 100
+
+// isAdmin reports whether ident is listed in the configured audit
+// admins.
+func (s *Server) isAdmin(ident string) bool {
+	for _, admin := range s.config.Audit.Admins {
+		if admin == ident {
+			return true
+		}
+	}
+	return false
+}
+
+// auditEvent records event for the caller of r, swallowing any
+// auditor error since auditing must never block the primary request
+// flow.
+func (s *Server) auditEvent(r *http.Request, ident, username, event string, success bool, reason string) {
+	if s.auditor == nil {
+		return
+	}
+
+	s.auditor.Record(auth.AuditEvent{
+		Timestamp: time.Now(),
+		Ident:     ident,
+		Username:  username,
+		RemoteIP:  s.limiter.remoteIP(r),
+		UserAgent: r.UserAgent(),
+		Event:     event,
+		Success:   success,
+		Reason:    reason,
+	})
+}
+
+// GET /api/admin/audit?ident=&since=&limit=
+func (s *Server) handlerAPIAdminAudit(w http.ResponseWriter, r *http.Request) {
+	if !s.limiter.Check("adminAudit", s.resolveRateLimitIdent(r), w, r) {
+		s.handlerAPIRateLimitError(w, r)
+		return
+	}
+
+	callerIdent := s.reqAuth.Check(w, r)
+	if callerIdent == "" {
+		return
+	}
+	if !s.isAdmin(callerIdent) {
+		s.handlerAPIUnauthorizedError(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+	targetIdent := query.Get("ident")
+	if targetIdent == "" {
+		jsonResponse(w, http.StatusBadRequest, apiError(http.StatusBadRequest, "ident is required"))
+		return
+	}
+
+	since := time.Time{}
+	if rawSince := query.Get("since"); rawSince != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339, rawSince)
+		if err != nil {
+			jsonResponse(w, http.StatusBadRequest, apiError(http.StatusBadRequest, "since format is not RFC3339"))
+			return
+		}
+	}
+
+	limit := defaultAuditListLimit
+	if rawLimit := query.Get("limit"); rawLimit != "" {
+		parsed, err := strconv.Atoi(rawLimit)
+		if err != nil || parsed <= 0 {
+			jsonResponse(w, http.StatusBadRequest, apiError(http.StatusBadRequest, "limit must be a positive integer"))
+			return
+		}
+		limit = parsed
+	}
+
+	events, err := s.auditor.ListEvents(targetIdent, since, limit)
+	if err != nil {
+		s.handlerAPIInternalError(w, r, err)
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"data": events,
+	})
+}
@@ -0,0 +1,40 @@
+package webserver
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+const healthCheckTimeout = 3 * time.Second
+
+// healthCheckResponseData contains the response data for
+// GET /api/health
+type healthCheckResponseData struct {
+	OK      bool   `json:"ok"`
+	Latency string `json:"latency"`
+}
+
+// GET /api/health
+//
+// Exercises the storage by creating and deleting a throwaway row and
+// reports the round-trip latency, mirroring the readiness/liveness
+// probe pattern of tools like dex.
+func (s *Server) handlerAPIHealth(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+
+	latency, err := s.db.HealthCheck(ctx)
+	if err != nil {
+		jsonResponse(w, http.StatusServiceUnavailable, healthCheckResponseData{
+			OK:      false,
+			Latency: latency.String(),
+		})
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, healthCheckResponseData{
+		OK:      true,
+		Latency: latency.String(),
+	})
+}
@@ -0,0 +1,238 @@
+package webserver
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/zekroTJA/vplan2019/internal/auth"
+	"golang.org/x/oauth2"
+)
+
+const (
+	ssoLoginTokenTTL = 2 * time.Minute
+
+	// ssoStateCookiePrefix namespaces the per-flow CSRF state cookie
+	// by provider, so that concurrent logins against different
+	// providers in the same browser don't clobber each other.
+	ssoStateCookiePrefix = "sso_state_"
+	ssoStateTTL          = 5 * time.Minute
+)
+
+// oauth2Config builds an *oauth2.Config from the SSOProvider entry
+// configured for the given provider name.
+func (s *Server) oauth2Config(provider string) (*oauth2.Config, bool) {
+	p, ok := s.config.Sessions.SSOProviders[provider]
+	if !ok {
+		return nil, false
+	}
+
+	return &oauth2.Config{
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		RedirectURL:  p.RedirectURL,
+		Scopes:       p.Scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  p.AuthURL,
+			TokenURL: p.TokenURL,
+		},
+	}, true
+}
+
+// newSSOState generates a random, per-flow CSRF state value.
+func newSSOState() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// GET /api/authenticate/sso/:provider
+//
+// Redirects the client to the configured identity provider's
+// authorization endpoint, analogous to Matrix's m.login.sso. A random
+// state value is minted and stored in a short-lived, HttpOnly cookie
+// so that the callback can verify the flow it completes is the one it
+// started, preventing login CSRF.
+func (s *Server) handlerAPISSOLogin(w http.ResponseWriter, r *http.Request) {
+	if !s.limiter.Check("authenticateSSO", s.resolveRateLimitIdent(r), w, r) {
+		s.handlerAPIRateLimitError(w, r)
+		return
+	}
+
+	provider := mux.Vars(r)["provider"]
+	oc, ok := s.oauth2Config(provider)
+	if !ok {
+		jsonResponse(w, http.StatusNotFound, apiError(http.StatusNotFound, "unknown sso provider"))
+		return
+	}
+
+	state, err := newSSOState()
+	if err != nil {
+		s.handlerAPIInternalError(w, r, err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     ssoStateCookiePrefix + provider,
+		Value:    state,
+		Path:     "/",
+		Expires:  time.Now().Add(ssoStateTTL),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, oc.AuthCodeURL(state), http.StatusFound)
+}
+
+// ssoUserInfo is the subset of claims read from the identity
+// provider's userinfo endpoint to resolve a remote identity.
+type ssoUserInfo struct {
+	Sub   string `json:"sub"`
+	Email string `json:"email"`
+}
+
+// GET /api/authenticate/sso/:provider/callback
+//
+// Exchanges the authorization code returned by the identity provider
+// for an access token, resolves the remote identity and mints a
+// single-use login token, which the client then exchanges for a
+// regular session/API token via POST /api/authenticate/:USERNAME
+// using `"type": "token"`.
+func (s *Server) handlerAPISSOCallback(w http.ResponseWriter, r *http.Request) {
+	if !s.limiter.Check("authenticateSSO", s.resolveRateLimitIdent(r), w, r) {
+		s.handlerAPIRateLimitError(w, r)
+		return
+	}
+
+	provider := mux.Vars(r)["provider"]
+	oc, ok := s.oauth2Config(provider)
+	if !ok {
+		jsonResponse(w, http.StatusNotFound, apiError(http.StatusNotFound, "unknown sso provider"))
+		return
+	}
+
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		jsonResponse(w, http.StatusBadRequest, apiError(http.StatusBadRequest, "missing code"))
+		return
+	}
+
+	if !s.checkSSOState(w, r, provider) {
+		jsonResponse(w, http.StatusBadRequest, apiError(http.StatusBadRequest, "invalid or missing state"))
+		return
+	}
+
+	ctx := r.Context()
+	oauthToken, err := oc.Exchange(ctx, code)
+	if err != nil {
+		jsonResponse(w, http.StatusUnauthorized, apiError(http.StatusUnauthorized, err.Error()))
+		return
+	}
+
+	ident, err := s.resolveSSOIdent(ctx, provider, oc, oauthToken)
+	if err != nil {
+		s.handlerAPIInternalError(w, r, err)
+		return
+	}
+
+	token, expire, err := s.loginTokenProvider.CreateLoginToken(ident, ssoLoginTokenTTL)
+	if err != nil {
+		s.handlerAPIInternalError(w, r, err)
+		return
+	}
+
+	s.auditEvent(r, ident, "", "sso-login", true, "provider="+provider)
+
+	jsonResponse(w, http.StatusOK, authTokenResposeData{
+		Token:  token,
+		Expire: expire,
+		authResponseData: &authResponseData{
+			Ident: ident,
+		},
+	})
+}
+
+// checkSSOState verifies that the request's "state" query parameter
+// matches the value minted for this flow by handlerAPISSOLogin,
+// consuming (deleting) the state cookie in the process so that it
+// cannot be replayed.
+func (s *Server) checkSSOState(w http.ResponseWriter, r *http.Request, provider string) bool {
+	cookieName := ssoStateCookiePrefix + provider
+
+	cookie, err := r.Cookie(cookieName)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+
+	state := r.URL.Query().Get("state")
+	if state == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) == 1
+}
+
+// authenticateByLoginToken consumes a single-use login token, minted
+// by the SSO callback flow, and resolves it to an auth.Response.
+func (s *Server) authenticateByLoginToken(token string) (*auth.Response, error) {
+	if token == "" {
+		return nil, errors.New("missing token")
+	}
+
+	ident, err := s.loginTokenProvider.ConsumeLoginToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if ident == "" {
+		return nil, errors.New("invalid or expired token")
+	}
+
+	return &auth.Response{Ident: ident}, nil
+}
+
+// resolveSSOIdent queries the provider's userinfo endpoint with the
+// freshly obtained access token and derives a local ident from it.
+func (s *Server) resolveSSOIdent(ctx context.Context, provider string, oc *oauth2.Config, token *oauth2.Token) (string, error) {
+	p, _ := s.config.Sessions.SSOProviders[provider]
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.UserInfoURL, nil)
+	if err != nil {
+		return "", err
+	}
+	token.SetAuthHeader(req)
+
+	resp, err := oc.Client(ctx, token).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("userinfo endpoint returned status %d", resp.StatusCode)
+	}
+
+	info := new(ssoUserInfo)
+	if err := json.NewDecoder(resp.Body).Decode(info); err != nil {
+		return "", err
+	}
+
+	return provider + ":" + info.Sub, nil
+}
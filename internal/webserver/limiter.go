@@ -0,0 +1,296 @@
+package webserver
+
+import (
+	"container/list"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/zekroTJA/vplan2019/internal/config"
+)
+
+// RateLimiter is a per-route, per-key token-bucket rate limiter. The
+// key is the authenticated ident when known, and otherwise the
+// client's remote IP, resolved via X-Forwarded-For when the request
+// came through a configured trusted proxy.
+type RateLimiter struct {
+	cfg config.RateLimit
+
+	trustedProxies []*net.IPNet
+
+	mx        sync.Mutex
+	buckets   map[string]*list.Element
+	bucketLRU *list.List
+
+	failuresMx sync.Mutex
+	failures   map[string]*list.Element
+	failureLRU *list.List
+}
+
+// limiterEntry is the bucketLRU payload; bucketKey lets eviction find
+// and delete the corresponding entry in buckets.
+type limiterEntry struct {
+	bucketKey string
+	limiter   *rate.Limiter
+}
+
+type failureEntry struct {
+	username string
+	count    int
+	until    time.Time
+}
+
+// NewRateLimiter creates a RateLimiter from the given config.
+func NewRateLimiter(cfg config.RateLimit) *RateLimiter {
+	l := &RateLimiter{
+		cfg:        cfg,
+		buckets:    make(map[string]*list.Element),
+		bucketLRU:  list.New(),
+		failures:   make(map[string]*list.Element),
+		failureLRU: list.New(),
+	}
+
+	for _, cidr := range cfg.TrustedProxies {
+		if _, ipNet, err := net.ParseCIDR(cidr); err == nil {
+			l.trustedProxies = append(l.trustedProxies, ipNet)
+		}
+	}
+
+	return l
+}
+
+// Check reports whether the request to route is allowed under its
+// token bucket, keyed by ident (see keyFor). If not, it sets
+// Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining and
+// X-RateLimit-Reset response headers and returns false; the caller is
+// expected to write the rejection response (see
+// handlerAPIRateLimitError).
+//
+// ident must already be verified by the caller, e.g. via
+// Server.resolveRateLimitIdent, and not simply copied from an
+// unauthenticated Authorization header or cookie: a client able to
+// pick its own key could otherwise always land in a fresh, full
+// bucket by sending a different value on every request.
+func (l *RateLimiter) Check(route, ident string, w http.ResponseWriter, r *http.Request) bool {
+	return l.check(route, l.bucketFor(route), l.keyFor(ident, r), w)
+}
+
+// CheckAuthenticate is a stricter variant of Check used for
+// POST /api/authenticate/:USERNAME. In addition to the per-key
+// token bucket, it applies an exponential backoff once username has
+// accumulated more than Authenticate.MaxFailures consecutive failed
+// passwords, to blunt credential-stuffing attacks.
+func (l *RateLimiter) CheckAuthenticate(username string, w http.ResponseWriter, r *http.Request) bool {
+	if until, blocked := l.backoffActive(username); blocked {
+		w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(until).Seconds())+1))
+		return false
+	}
+
+	bucket := l.cfg.Authenticate.RateLimitBucket
+	return l.check("authenticate", bucket, l.keyFor("", r), w)
+}
+
+// RecordAuthResult updates the consecutive-failure counter tracked
+// for username. A success resets the counter; a failure increments it
+// and, once MaxFailures is exceeded, arms an exponential backoff.
+func (l *RateLimiter) RecordAuthResult(username string, success bool) {
+	maxTracked := l.cfg.Authenticate.TrackedUsernames
+	if maxTracked <= 0 {
+		maxTracked = 10000
+	}
+
+	l.failuresMx.Lock()
+	defer l.failuresMx.Unlock()
+
+	elem, ok := l.failures[username]
+	if !ok {
+		if l.failureLRU.Len() >= maxTracked {
+			oldest := l.failureLRU.Back()
+			if oldest != nil {
+				l.failureLRU.Remove(oldest)
+				delete(l.failures, oldest.Value.(*failureEntry).username)
+			}
+		}
+		entry := &failureEntry{username: username}
+		elem = l.failureLRU.PushFront(entry)
+		l.failures[username] = elem
+	} else {
+		l.failureLRU.MoveToFront(elem)
+	}
+
+	entry := elem.Value.(*failureEntry)
+	if success {
+		entry.count = 0
+		entry.until = time.Time{}
+		return
+	}
+
+	entry.count++
+	if entry.count <= l.cfg.Authenticate.MaxFailures {
+		return
+	}
+
+	base := l.cfg.Authenticate.BackoffBase
+	if base <= 0 {
+		base = time.Second
+	}
+	max := l.cfg.Authenticate.BackoffMax
+	if max <= 0 {
+		max = 5 * time.Minute
+	}
+
+	backoff := base << uint(entry.count-l.cfg.Authenticate.MaxFailures-1)
+	if backoff <= 0 || backoff > max {
+		backoff = max
+	}
+	entry.until = time.Now().Add(backoff)
+}
+
+func (l *RateLimiter) backoffActive(username string) (time.Time, bool) {
+	l.failuresMx.Lock()
+	defer l.failuresMx.Unlock()
+
+	elem, ok := l.failures[username]
+	if !ok {
+		return time.Time{}, false
+	}
+	entry := elem.Value.(*failureEntry)
+	if entry.until.IsZero() || time.Now().After(entry.until) {
+		return time.Time{}, false
+	}
+	return entry.until, true
+}
+
+func (l *RateLimiter) bucketFor(route string) config.RateLimitBucket {
+	if b, ok := l.cfg.Routes[route]; ok {
+		return b
+	}
+	return l.cfg.Default
+}
+
+func (l *RateLimiter) check(route string, bucket config.RateLimitBucket, key string, w http.ResponseWriter) bool {
+	limiter := l.limiterFor(route, bucket, key)
+
+	reservation := limiter.Reserve()
+	delay := reservation.Delay()
+
+	burst := bucket.Burst
+	if burst <= 0 {
+		burst = 1
+	}
+	remaining := int(limiter.Tokens())
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	if delay > 0 {
+		reservation.Cancel()
+		w.Header().Set("Retry-After", strconv.Itoa(int(delay.Seconds())+1))
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(burst))
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(delay).Unix(), 10))
+		return false
+	}
+
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(burst))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Unix(), 10))
+	return true
+}
+
+// limiterFor returns the token bucket for route+key, creating it if
+// necessary. Buckets are tracked on bucketLRU, the same bounded-LRU
+// pattern used by failureLRU above, so that an anonymous client
+// cannot grow this map without bound by sending one request per
+// random header/cookie value.
+func (l *RateLimiter) limiterFor(route string, bucket config.RateLimitBucket, key string) *rate.Limiter {
+	bucketKey := route + "\x00" + key
+
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	if elem, ok := l.buckets[bucketKey]; ok {
+		l.bucketLRU.MoveToFront(elem)
+		return elem.Value.(*limiterEntry).limiter
+	}
+
+	maxTracked := l.cfg.MaxTrackedKeys
+	if maxTracked <= 0 {
+		maxTracked = 10000
+	}
+	if l.bucketLRU.Len() >= maxTracked {
+		oldest := l.bucketLRU.Back()
+		if oldest != nil {
+			l.bucketLRU.Remove(oldest)
+			delete(l.buckets, oldest.Value.(*limiterEntry).bucketKey)
+		}
+	}
+
+	refill := bucket.RefillPerSec
+	if refill <= 0 {
+		refill = 1
+	}
+	burst := bucket.Burst
+	if burst <= 0 {
+		burst = 1
+	}
+
+	entry := &limiterEntry{
+		bucketKey: bucketKey,
+		limiter:   rate.NewLimiter(rate.Limit(refill), burst),
+	}
+	l.buckets[bucketKey] = l.bucketLRU.PushFront(entry)
+
+	return entry.limiter
+}
+
+// keyFor resolves the rate-limit key: the verified ident when the
+// caller was able to resolve one, otherwise the client's remote IP,
+// honoring X-Forwarded-For when RemoteAddr matches a configured
+// trusted proxy.
+//
+// ident must come from an actual credential lookup, not merely be
+// copied from request headers/cookies - see Check's doc comment.
+func (l *RateLimiter) keyFor(ident string, r *http.Request) string {
+	if ident != "" {
+		return "ident:" + ident
+	}
+	return "ip:" + l.remoteIP(r)
+}
+
+func (l *RateLimiter) remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if !l.isTrustedProxy(host) {
+		return host
+	}
+
+	forwarded := r.Header.Get("X-Forwarded-For")
+	if forwarded == "" {
+		return host
+	}
+
+	parts := strings.Split(forwarded, ",")
+	return strings.TrimSpace(parts[0])
+}
+
+func (l *RateLimiter) isTrustedProxy(host string) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, proxyNet := range l.trustedProxies {
+		if proxyNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}